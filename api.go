@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serveAPI starts the embedded control/status HTTP server on addr. It's
+// off by default - callers only invoke this when an address is
+// configured - so plain `vx-check` runs exactly as before.
+func serveAPI(addr string, checker *Checker) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", checker.handleHealthz)
+	mux.HandleFunc("/checks", checker.handleChecks)
+	mux.HandleFunc("/checks/", checker.handleCheck)
+	mux.HandleFunc("/run", checker.handleRun)
+	mux.HandleFunc("/reload", checker.handleReload)
+
+	log.Printf("Control API listening on %s", addr)
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("serveAPI: ListenAndServe(%s) - %s", addr, err)
+		}
+	}()
+}
+
+func (self *Checker) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	_, lastRun := self.LastResult()
+
+	if lastRun.IsZero() || time.Since(lastRun) > 2*self.MaxInterval() {
+		http.Error(w, "stale", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (self *Checker) handleChecks(w http.ResponseWriter, r *http.Request) {
+	statuses, _ := self.LastResult()
+	writeJSON(w, statuses)
+}
+
+func (self *Checker) handleCheck(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/checks/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	statuses, _ := self.LastResult()
+	for _, status := range statuses {
+		if status.Unit == name {
+			writeJSON(w, status)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (self *Checker) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, self.Run())
+}
+
+func (self *Checker) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := self.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writeJSON failed: %+v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseCheckArgs splits an X-Check value of the form
+// "<target> key=value key=value ..." into the target and its key/value
+// arguments.
+func parseCheckArgs(value string) (string, map[string]string) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", map[string]string{}
+	}
+
+	args := map[string]string{}
+	for _, field := range fields[1:] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) == 2 {
+			args[parts[0]] = parts[1]
+		}
+	}
+
+	return fields[0], args
+}
+
+func argDuration(args map[string]string, key string, def time.Duration) time.Duration {
+	if raw, ok := args[key]; ok {
+		if d, err := time.ParseDuration(raw); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func argInt(args map[string]string, key string, def int) int {
+	if raw, ok := args[key]; ok {
+		if n, err := strconv.Atoi(raw); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// CheckHttp requests a URL and compares the response status code against
+// Expect, e.g. `X-Check: Http = https://localhost:8080/health expect=200 timeout=3s`.
+// A response that doesn't match Expect but isn't a server error is WARN
+// (the endpoint answered, just not the way we wanted); a 5xx or a failed
+// request is CRIT.
+type CheckHttp struct {
+	URL     string
+	Expect  int
+	Timeout time.Duration
+}
+
+func NewCheckHttp(value string) CheckHttp {
+	target, args := parseCheckArgs(value)
+	return CheckHttp{
+		URL:     target,
+		Expect:  argInt(args, "expect", 200),
+		Timeout: argDuration(args, "timeout", 5*time.Second),
+	}
+}
+
+func (self CheckHttp) Get(ctx context.Context, name string) Status {
+	newStatus := Status{
+		Unit: name,
+		Host: hostname,
+		Id:   "http.check_status",
+	}
+
+	client := &http.Client{Timeout: self.Timeout}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", self.URL, nil)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("http.NewRequestWithContext(%s) - %s", self.URL, err)
+		return newStatus
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("http.Get(%s) - %s", self.URL, err)
+		return newStatus
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != self.Expect {
+		if resp.StatusCode >= 500 {
+			newStatus.Code = CRIT
+		} else {
+			newStatus.Code = WARN
+		}
+		newStatus.Desc = fmt.Sprintf("%s returned %d, expected %d", self.URL, resp.StatusCode, self.Expect)
+		return newStatus
+	}
+
+	newStatus.Code = SUCC
+	newStatus.Desc = fmt.Sprintf("%s returned %d", self.URL, resp.StatusCode)
+	return newStatus
+}
+
+// CheckTcp dials a host:port and reports CRIT if the connection fails,
+// e.g. `X-Check: Tcp = 127.0.0.1:5432 timeout=2s warn=500ms`. A connect
+// slower than Warn (if set) is WARN rather than SUCC - the port is up,
+// but something's straining.
+type CheckTcp struct {
+	Addr    string
+	Timeout time.Duration
+	Warn    time.Duration
+}
+
+func NewCheckTcp(value string) CheckTcp {
+	target, args := parseCheckArgs(value)
+	return CheckTcp{
+		Addr:    target,
+		Timeout: argDuration(args, "timeout", 5*time.Second),
+		Warn:    argDuration(args, "warn", 0),
+	}
+}
+
+func (self CheckTcp) Get(ctx context.Context, name string) Status {
+	newStatus := Status{
+		Unit: name,
+		Host: hostname,
+		Id:   "tcp.check_status",
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, self.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", self.Addr)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("DialContext(%s) - %s", self.Addr, err)
+		return newStatus
+	}
+	conn.Close()
+	elapsed := time.Since(start)
+
+	if self.Warn > 0 && elapsed > self.Warn {
+		newStatus.Code = WARN
+		newStatus.Desc = fmt.Sprintf("%s accepted connection in %s, warn=%s", self.Addr, elapsed, self.Warn)
+		return newStatus
+	}
+
+	newStatus.Code = SUCC
+	newStatus.Desc = fmt.Sprintf("%s accepted connection", self.Addr)
+	return newStatus
+}
+
+// CheckProcess counts running processes whose argv[0] (the first field of
+// /proc/<pid>/cmdline) is exactly Path and compares the count against
+// [Min, Max], e.g.
+// `X-Check: Process = /usr/bin/myapp min=1 max=4`.
+type CheckProcess struct {
+	Path string
+	Min  int
+	Max  int
+}
+
+func NewCheckProcess(value string) CheckProcess {
+	target, args := parseCheckArgs(value)
+	return CheckProcess{
+		Path: target,
+		Min:  argInt(args, "min", 1),
+		Max:  argInt(args, "max", 0),
+	}
+}
+
+func (self CheckProcess) Get(ctx context.Context, name string) Status {
+	newStatus := Status{
+		Unit: name,
+		Host: hostname,
+		Id:   "process.check_status",
+	}
+
+	count, err := countProcesses(self.Path)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("countProcesses(%s) - %s", self.Path, err)
+		return newStatus
+	}
+
+	if count == 0 {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("%s has no running instances, expected %d-%d", self.Path, self.Min, self.Max)
+		return newStatus
+	}
+
+	if count < self.Min || (self.Max > 0 && count > self.Max) {
+		newStatus.Code = WARN
+		newStatus.Desc = fmt.Sprintf("%s has %d running instances, expected %d-%d", self.Path, count, self.Min, self.Max)
+		return newStatus
+	}
+
+	newStatus.Code = SUCC
+	newStatus.Desc = fmt.Sprintf("%s has %d running instances", self.Path, count)
+	return newStatus
+}
+
+func countProcesses(path string) (int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if argv0 == path {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CheckFile reports CRIT if Path is missing or hasn't been modified
+// within MaxAge, e.g. `X-Check: File = /var/run/app.pid maxage=60s warn=30s`.
+// An optional Warn threshold below MaxAge reports WARN instead, so
+// operators get a heads-up before the hard CRIT boundary.
+type CheckFile struct {
+	Path   string
+	MaxAge time.Duration
+	Warn   time.Duration
+}
+
+func NewCheckFile(value string) CheckFile {
+	target, args := parseCheckArgs(value)
+	return CheckFile{
+		Path:   target,
+		MaxAge: argDuration(args, "maxage", time.Minute),
+		Warn:   argDuration(args, "warn", 0),
+	}
+}
+
+func (self CheckFile) Get(ctx context.Context, name string) Status {
+	newStatus := Status{
+		Unit: name,
+		Host: hostname,
+		Id:   "file.check_status",
+	}
+
+	info, err := os.Stat(self.Path)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("os.Stat(%s) - %s", self.Path, err)
+		return newStatus
+	}
+
+	age := time.Since(info.ModTime())
+	if age > self.MaxAge {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("%s is %s old, older than maxage=%s", self.Path, age, self.MaxAge)
+		return newStatus
+	}
+
+	if self.Warn > 0 && age > self.Warn {
+		newStatus.Code = WARN
+		newStatus.Desc = fmt.Sprintf("%s is %s old, older than warn=%s", self.Path, age, self.Warn)
+		return newStatus
+	}
+
+	newStatus.Code = SUCC
+	newStatus.Desc = fmt.Sprintf("%s is %s old", self.Path, age)
+	return newStatus
+}
+
+// CheckJournalErrors counts error-priority journal entries for Unit
+// within the last Window and compares the count against Threshold, e.g.
+// `X-Check: JournalErrors = unit=myapp.service window=5m threshold=10 warn=5`.
+// An optional Warn threshold below Threshold reports WARN instead.
+type CheckJournalErrors struct {
+	Unit      string
+	Window    time.Duration
+	Threshold int
+	Warn      int
+}
+
+func NewCheckJournalErrors(value string) CheckJournalErrors {
+	_, args := parseCheckArgs(value)
+	return CheckJournalErrors{
+		Unit:      args["unit"],
+		Window:    argDuration(args, "window", 5*time.Minute),
+		Threshold: argInt(args, "threshold", 10),
+		Warn:      argInt(args, "warn", 0),
+	}
+}
+
+// journalctlErrorCount shells out to journalctl; it's a var so tests can
+// stub it without a real journald. It's run via exec.CommandContext so a
+// hung/slow journalctl is actually killed when ctx's deadline (the check's
+// Timeout) expires, instead of leaking a subprocess on every timed-out cycle.
+var journalctlErrorCount = func(ctx context.Context, unit string, window time.Duration) (int, error) {
+	cmd := exec.CommandContext(ctx, "journalctl",
+		"-u", unit,
+		"-p", "err",
+		"--since", fmt.Sprintf("-%s", window),
+		"-o", "cat",
+		"--no-pager")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("journalctl - %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return 0, nil
+	}
+
+	return len(lines), nil
+}
+
+func (self CheckJournalErrors) Get(ctx context.Context, name string) Status {
+	newStatus := Status{
+		Unit: name,
+		Host: hostname,
+		Id:   "journal.check_status",
+	}
+
+	count, err := journalctlErrorCount(ctx, self.Unit, self.Window)
+	if err != nil {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("journalctlErrorCount(%s) - %s", self.Unit, err)
+		return newStatus
+	}
+
+	if count > self.Threshold {
+		newStatus.Code = CRIT
+		newStatus.Desc = fmt.Sprintf("%s logged %d errors in %s, threshold=%d", self.Unit, count, self.Window, self.Threshold)
+		return newStatus
+	}
+
+	if self.Warn > 0 && count > self.Warn {
+		newStatus.Code = WARN
+		newStatus.Desc = fmt.Sprintf("%s logged %d errors in %s, warn=%d", self.Unit, count, self.Window, self.Warn)
+		return newStatus
+	}
+
+	newStatus.Code = SUCC
+	newStatus.Desc = fmt.Sprintf("%s logged %d errors in %s", self.Unit, count, self.Window)
+	return newStatus
+}
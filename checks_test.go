@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHttpSucc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	check := NewCheckHttp(fmt.Sprintf("%s expect=200 timeout=1s", server.URL))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != SUCC {
+		t.Fatalf("expected SUCC, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckHttpUnexpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	check := NewCheckHttp(fmt.Sprintf("%s expect=200 timeout=1s", server.URL))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != CRIT {
+		t.Fatalf("expected CRIT, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckTcpSucc(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	check := NewCheckTcp(fmt.Sprintf("%s timeout=1s", listener.Addr().String()))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != SUCC {
+		t.Fatalf("expected SUCC, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckTcpRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	check := NewCheckTcp(fmt.Sprintf("%s timeout=1s", addr))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != CRIT {
+		t.Fatalf("expected CRIT, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckFileFresh(t *testing.T) {
+	file, err := os.CreateTemp("", "vx-check-file-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	check := NewCheckFile(fmt.Sprintf("%s maxage=1m", file.Name()))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != SUCC {
+		t.Fatalf("expected SUCC, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckFileStale(t *testing.T) {
+	file, err := os.CreateTemp("", "vx-check-file-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	check := NewCheckFile(fmt.Sprintf("%s maxage=1m", file.Name()))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != CRIT {
+		t.Fatalf("expected CRIT, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckJournalErrorsOverThreshold(t *testing.T) {
+	orig := journalctlErrorCount
+	defer func() { journalctlErrorCount = orig }()
+
+	journalctlErrorCount = func(ctx context.Context, unit string, window time.Duration) (int, error) {
+		return 42, nil
+	}
+
+	check := NewCheckJournalErrors("unit=myapp.service window=5m threshold=10")
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != CRIT {
+		t.Fatalf("expected CRIT, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckJournalErrorsUnderThreshold(t *testing.T) {
+	orig := journalctlErrorCount
+	defer func() { journalctlErrorCount = orig }()
+
+	journalctlErrorCount = func(ctx context.Context, unit string, window time.Duration) (int, error) {
+		return 1, nil
+	}
+
+	check := NewCheckJournalErrors("unit=myapp.service window=5m threshold=10")
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != SUCC {
+		t.Fatalf("expected SUCC, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func currentProcessPath(t *testing.T) string {
+	data, err := ioutil.ReadFile("/proc/self/cmdline")
+	if err != nil {
+		t.Skip("no /proc/self/cmdline on this platform")
+	}
+
+	argv0 := strings.SplitN(string(data), "\x00", 2)[0]
+	if argv0 == "" {
+		t.Skip("empty argv0 in /proc/self/cmdline")
+	}
+
+	return argv0
+}
+
+func TestCheckProcessRunning(t *testing.T) {
+	path := currentProcessPath(t)
+
+	check := NewCheckProcess(fmt.Sprintf("%s min=1", path))
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != SUCC {
+		t.Fatalf("expected SUCC, got %d (%s)", status.Code, status.Desc)
+	}
+}
+
+func TestCheckProcessNotRunning(t *testing.T) {
+	check := NewCheckProcess("/nonexistent/vx-check-test-binary min=1")
+	status := check.Get(context.Background(), "myapp.service")
+
+	if status.Code != CRIT {
+		t.Fatalf("expected CRIT, got %d (%s)", status.Code, status.Desc)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/unit"
+)
+
+const (
+	defaultAlertThreshold = 1
+	defaultFlapWindow     = 5 * time.Minute
+	defaultFlapThreshold  = 5
+)
+
+// AlertingConfig holds the optional [Alerting] tuning read from the
+// config file. A zero field means "leave the Checker's default alone".
+type AlertingConfig struct {
+	AlertThreshold int
+	FlapWindow     time.Duration
+	FlapThreshold  int
+}
+
+// LoadAlertingConfig parses the [Alerting] section of the same
+// systemd-unit-style config file LoadNotifiers reads, e.g.:
+//
+//	[Alerting]
+//	AlertThreshold=3
+//	FlapWindow=2m
+//	FlapThreshold=4
+func LoadAlertingConfig(path string) (AlertingConfig, error) {
+	var cfg AlertingConfig
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	sections, err := unit.Deserialize(bytes.NewReader(content))
+	if err != nil {
+		return cfg, err
+	}
+
+	for _, section := range sections {
+		if section.Section != "Alerting" {
+			continue
+		}
+
+		switch section.Name {
+		case "AlertThreshold":
+			if n, err := strconv.Atoi(section.Value); err == nil {
+				cfg.AlertThreshold = n
+			}
+		case "FlapWindow":
+			if d, err := time.ParseDuration(section.Value); err == nil {
+				cfg.FlapWindow = d
+			}
+		case "FlapThreshold":
+			if n, err := strconv.Atoi(section.Value); err == nil {
+				cfg.FlapThreshold = n
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// unitState is the stateful memory Checker keeps per unit to decide
+// whether a Status is worth alerting on. It's persisted to StatePath as
+// JSON so a restart doesn't re-alert on everything.
+type unitState struct {
+	LastCode        int
+	LastAlertedCode int
+	ConsecFailures  int
+	Transitions     []time.Time
+	Flapping        bool
+}
+
+// filterAlerts decides, per unit, whether this cycle's Status is worth
+// notifying about: only state transitions page (not every cycle), a
+// unit must fail AlertThreshold cycles in a row before its first alert,
+// and a unit flipping states more than FlapThreshold times within
+// FlapWindow is marked Flapping and alerted once, then suppressed until
+// it settles down.
+func (self *Checker) filterAlerts(statuses []Status) []Status {
+	self.stateMu.Lock()
+	defer self.stateMu.Unlock()
+
+	now := time.Now()
+	var toSend []Status
+
+	for _, status := range statuses {
+		st, ok := self.flapState[status.Unit]
+		if !ok {
+			st = &unitState{LastCode: -1, LastAlertedCode: -1}
+			self.flapState[status.Unit] = st
+		}
+
+		if status.Code != st.LastCode {
+			st.Transitions = append(st.Transitions, now)
+		}
+		st.Transitions = pruneBefore(st.Transitions, now.Add(-self.FlapWindow))
+
+		if status.Code == SUCC {
+			st.ConsecFailures = 0
+		} else {
+			st.ConsecFailures++
+		}
+
+		wasFlapping := st.Flapping
+		st.Flapping = self.FlapThreshold > 0 && len(st.Transitions) > self.FlapThreshold
+
+		alert := false
+		switch {
+		case st.Flapping:
+			alert = !wasFlapping
+		case status.Code == SUCC:
+			alert = st.LastAlertedCode != -1 && st.LastAlertedCode != SUCC
+		default:
+			alert = st.ConsecFailures == self.AlertThreshold && st.LastAlertedCode != status.Code
+		}
+
+		st.LastCode = status.Code
+
+		if alert {
+			st.LastAlertedCode = status.Code
+			status.Flapping = st.Flapping
+			toSend = append(toSend, status)
+		}
+	}
+
+	self.saveState()
+
+	return toSend
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	pruned := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			pruned = append(pruned, t)
+		}
+	}
+	return pruned
+}
+
+// LoadState reads persisted flap/alert state from StatePath, if set and
+// present. A missing file just means a cold start.
+func (self *Checker) LoadState() error {
+	if self.StatePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(self.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	self.stateMu.Lock()
+	defer self.stateMu.Unlock()
+
+	return json.Unmarshal(data, &self.flapState)
+}
+
+// saveState writes the current flap/alert state to StatePath. Called
+// with stateMu already held.
+func (self *Checker) saveState() {
+	if self.StatePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(self.flapState)
+	if err != nil {
+		log.Printf("saveState: json.Marshal() - %s", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(self.StatePath, data, 0644); err != nil {
+		log.Printf("saveState: ioutil.WriteFile(%s) - %s", self.StatePath, err)
+	}
+}
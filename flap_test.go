@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestChecker() *Checker {
+	return &Checker{
+		AlertThreshold: 2,
+		FlapWindow:     time.Minute,
+		FlapThreshold:  3,
+		flapState:      map[string]*unitState{},
+	}
+}
+
+func TestFilterAlertsWaitsForConsecutiveFailures(t *testing.T) {
+	checker := newTestChecker()
+	unit := "myapp.service"
+
+	first := checker.filterAlerts([]Status{{Unit: unit, Code: CRIT}})
+	if len(first) != 0 {
+		t.Fatalf("expected no alert on first failure, got %d", len(first))
+	}
+
+	second := checker.filterAlerts([]Status{{Unit: unit, Code: CRIT}})
+	if len(second) != 1 {
+		t.Fatalf("expected alert once AlertThreshold is reached, got %d", len(second))
+	}
+}
+
+func TestFilterAlertsSuppressesUnchangedState(t *testing.T) {
+	checker := newTestChecker()
+	checker.AlertThreshold = 1
+	unit := "myapp.service"
+
+	first := checker.filterAlerts([]Status{{Unit: unit, Code: CRIT}})
+	if len(first) != 1 {
+		t.Fatalf("expected alert on first failure, got %d", len(first))
+	}
+
+	second := checker.filterAlerts([]Status{{Unit: unit, Code: CRIT}})
+	if len(second) != 0 {
+		t.Fatalf("expected no repeat alert for unchanged state, got %d", len(second))
+	}
+
+	recovered := checker.filterAlerts([]Status{{Unit: unit, Code: SUCC}})
+	if len(recovered) != 1 {
+		t.Fatalf("expected alert on recovery, got %d", len(recovered))
+	}
+}
+
+func TestFilterAlertsDetectsFlapping(t *testing.T) {
+	checker := newTestChecker()
+	checker.AlertThreshold = 1
+	unit := "myapp.service"
+
+	codes := []int{CRIT, SUCC, CRIT, SUCC, CRIT, SUCC}
+	var alerts int
+
+	for _, code := range codes {
+		sent := checker.filterAlerts([]Status{{Unit: unit, Code: code}})
+		alerts += len(sent)
+	}
+
+	state := checker.flapState[unit]
+	if !state.Flapping {
+		t.Fatalf("expected unit to be marked flapping after %d transitions", len(codes))
+	}
+
+	if alerts >= len(codes) {
+		t.Fatalf("expected flapping to suppress repeat alerts, got %d alerts for %d transitions", alerts, len(codes))
+	}
+}
+
+func TestFilterAlertsClearsFlappingOnceWindowDecays(t *testing.T) {
+	checker := newTestChecker()
+	checker.AlertThreshold = 1
+	checker.FlapWindow = time.Millisecond
+	unit := "myapp.service"
+
+	codes := []int{CRIT, SUCC, CRIT, SUCC, CRIT, SUCC}
+	for _, code := range codes {
+		checker.filterAlerts([]Status{{Unit: unit, Code: code}})
+	}
+
+	if !checker.flapState[unit].Flapping {
+		t.Fatalf("expected unit to be marked flapping after %d transitions", len(codes))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	checker.filterAlerts([]Status{{Unit: unit, Code: SUCC}})
+
+	if checker.flapState[unit].Flapping {
+		t.Fatalf("expected Flapping to clear once the transition window decays with no new transitions")
+	}
+}
+
+func TestFilterAlertsCountsConsecutiveFailuresAcrossSeverities(t *testing.T) {
+	checker := newTestChecker()
+	checker.AlertThreshold = 3
+	unit := "myapp.service"
+
+	codes := []int{WARN, WARN, CRIT, CRIT, CRIT}
+	var alertedAt = -1
+
+	for i, code := range codes {
+		sent := checker.filterAlerts([]Status{{Unit: unit, Code: code}})
+		if len(sent) > 0 {
+			alertedAt = i
+			break
+		}
+	}
+
+	if alertedAt != 2 {
+		t.Fatalf("expected alert on the 3rd consecutive failing cycle (index 2) regardless of the WARN->CRIT transition, got index %d", alertedAt)
+	}
+}
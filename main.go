@@ -2,25 +2,29 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/coreos/go-systemd/dbus"
 	"github.com/coreos/go-systemd/unit"
 	"io/ioutil"
 	"log"
-	"net/http"
+	"math/rand"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 var (
-	unitPath = "/etc/systemd/system"
-	hostname string
-	apiKey   string
-	apiUrl   string
+	unitPath   = "/etc/systemd/system"
+	hostname   string
+	apiKey     string
+	configPath string
+	apiAddr    string
 )
 
 const (
@@ -30,53 +34,35 @@ const (
 )
 
 type Status struct {
-	Code int
-	Desc string
-	Unit string
-	Host string
-	Id   string
-}
-
-type DatadogStatus struct {
-	Check    string   `json:"check"`
-	HostName string   `json:"host_name"`
-	Status   int      `json:"status"`
-	Message  string   `json:"message"`
-	Tags     []string `json:"tags"`
+	Code     int
+	Desc     string
+	Unit     string
+	Host     string
+	Id       string
+	Flapping bool
 }
 
 func (self Status) String() string {
 	return fmt.Sprintf(
-		"id=\"%s\" unit=\"%s\" code=%d message=\"%s\" host=\"%s\"",
+		"id=\"%s\" unit=\"%s\" code=%d message=\"%s\" host=\"%s\" flapping=%t",
 		self.Id,
 		self.Unit,
 		self.Code,
 		self.Desc,
 		self.Host,
+		self.Flapping,
 	)
 }
 
-func NewDatadogStatus(s Status) DatadogStatus {
-	tags := []string{}
-	tags = append(tags, fmt.Sprintf("check:%s", s.Unit))
-	return DatadogStatus{
-		Check:    s.Id,
-		HostName: s.Host,
-		Status:   s.Code,
-		Message:  s.Desc,
-		Tags:     tags,
-	}
-}
-
 type Check interface {
-	Get(string) Status
+	Get(context.Context, string) Status
 }
 
 type CheckSystemdStatus struct {
 	Check
 }
 
-func (self CheckSystemdStatus) Get(name string) Status {
+func (self CheckSystemdStatus) Get(ctx context.Context, name string) Status {
 	newStatus := Status{
 		Unit: name,
 		Host: hostname,
@@ -130,17 +116,70 @@ func (self CheckSystemdStatus) Get(name string) Status {
 }
 
 type Unit struct {
-	Name   string
-	Desc   string
-	Checks []Check
+	Name     string
+	Desc     string
+	Checks   []Check
+	Interval time.Duration
+	Jitter   float64
+	Timeout  time.Duration
 }
 
+const (
+	defaultInterval     = 30 * time.Second
+	defaultCheckTimeout = 10 * time.Second
+	defaultConcurrency  = 50
+	schedulerTick       = time.Second
+)
+
 type Checker struct {
-	Units []Unit
-	done  chan bool
+	Path           string
+	Units          []Unit
+	Notifiers      []Notifier
+	Interval       time.Duration
+	Concurrency    int
+	AlertThreshold int
+	FlapWindow     time.Duration
+	FlapThreshold  int
+	StatePath      string
+
+	mu               sync.RWMutex
+	done             chan bool
+	nextRun          map[string]time.Time
+	lastStatusByUnit map[string]Status
+	lastRun          time.Time
+	sem              chan struct{}
+
+	stateMu   sync.Mutex
+	flapState map[string]*unitState
 }
 
 func NewChecker(path string) (*Checker, error) {
+	units, err := loadUnits(path)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &Checker{
+		Path:           path,
+		Units:          units,
+		Interval:       defaultInterval,
+		Concurrency:    defaultConcurrency,
+		AlertThreshold: defaultAlertThreshold,
+		FlapWindow:     defaultFlapWindow,
+		FlapThreshold:  defaultFlapThreshold,
+		done:           make(chan bool),
+		nextRun:        map[string]time.Time{},
+		flapState:      map[string]*unitState{},
+	}
+	checker.sem = make(chan struct{}, checker.Concurrency)
+
+	return checker, nil
+}
+
+// loadUnits globs path/*.service and parses the X-Check directives of
+// each into a Unit. It holds no state, so both NewChecker and
+// Checker.Reload can call it.
+func loadUnits(path string) ([]Unit, error) {
 	mask := fmt.Sprintf("%s/*.service", path)
 	log.Printf("Search services by %s", mask)
 	files, err := filepath.Glob(mask)
@@ -172,58 +211,245 @@ func NewChecker(path string) (*Checker, error) {
 				newUnit.Desc = section.Value
 			}
 
-			if section.Section == "X-Check" && section.Name == "Systemd" && section.Value == "status" {
-				newCheck := CheckSystemdStatus{}
-				checks = append(checks, newCheck)
+			if section.Section != "X-Check" {
+				continue
+			}
+
+			switch section.Name {
+			case "Systemd":
+				if section.Value == "status" {
+					checks = append(checks, CheckSystemdStatus{})
+				}
+			case "Http":
+				checks = append(checks, NewCheckHttp(section.Value))
+			case "Tcp":
+				checks = append(checks, NewCheckTcp(section.Value))
+			case "Process":
+				checks = append(checks, NewCheckProcess(section.Value))
+			case "File":
+				checks = append(checks, NewCheckFile(section.Value))
+			case "JournalErrors":
+				checks = append(checks, NewCheckJournalErrors(section.Value))
+			case "Interval":
+				if d, err := time.ParseDuration(section.Value); err == nil {
+					newUnit.Interval = d
+				}
+			case "Timeout":
+				if d, err := time.ParseDuration(section.Value); err == nil {
+					newUnit.Timeout = d
+				}
+			case "Jitter":
+				if pct, err := strconv.Atoi(strings.TrimSuffix(section.Value, "%")); err == nil {
+					newUnit.Jitter = float64(pct) / 100
+				}
 			}
 		}
 
+		if newUnit.Interval == 0 {
+			newUnit.Interval = defaultInterval
+		}
+		if newUnit.Timeout == 0 {
+			newUnit.Timeout = defaultCheckTimeout
+		}
+
 		if len(checks) > 0 {
 			newUnit.Checks = checks
 			units = append(units, newUnit)
 		}
 	}
 
-	checker := &Checker{
-		Units: units,
-		done:  make(chan bool),
+	return units, nil
+}
+
+// Reload re-scans Path for .service files and atomically swaps Units, so
+// operators can add or remove monitored units without restarting.
+func (self *Checker) Reload() error {
+	units, err := loadUnits(self.Path)
+	if err != nil {
+		return err
 	}
 
-	return checker, nil
+	self.mu.Lock()
+	self.Units = units
+	self.mu.Unlock()
+
+	log.Printf("Reloaded %d unit(s) from %s", len(units), self.Path)
+
+	return nil
 }
 
+// Run checks every unit right now, regardless of its configured Interval,
+// notifies whichever results filterAlerts passes, and returns all of the
+// results. It's used for the initial check at startup
+// and for the control API's POST /run.
 func (self *Checker) Run() []Status {
+	self.mu.RLock()
+	units := self.Units
+	self.mu.RUnlock()
 
-	newStatuses := []Status{}
+	newStatuses := self.runUnits(units)
+	self.scheduleNext(units)
 
-	for _, unit := range self.Units {
+	if toAlert := self.filterAlerts(newStatuses); len(toAlert) > 0 {
+		self.Notify(toAlert)
+	}
+
+	return newStatuses
+}
+
+// scheduleNext records when each of the given units is next due, so an
+// out-of-cycle run (the initial startup check, or a manual POST /run)
+// doesn't leave every unit looking overdue and get re-run on the very
+// next scheduler tick.
+func (self *Checker) scheduleNext(units []Unit) {
+	now := time.Now()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, unit := range units {
+		self.nextRun[unit.Name] = now.Add(jitter(unit.Interval, unit.Jitter))
+	}
+}
+
+// runUnits executes every check of every given unit concurrently. Each
+// check gets its own timeout so a single slow dbus call can't hang the
+// cycle, and a semaphore caps how many checks run at once so a host with
+// hundreds of units doesn't spawn unbounded dbus connections.
+func (self *Checker) runUnits(units []Unit) []Status {
+	type job struct {
+		unit  Unit
+		check Check
+	}
+
+	var jobs []job
+	for _, unit := range units {
 		for _, check := range unit.Checks {
-			newStatuses = append(newStatuses, check.Get(unit.Name))
+			jobs = append(jobs, job{unit, check})
 		}
 	}
 
-	for _, st := range newStatuses {
-		log.Printf("Check %s", st)
+	results := make(chan Status, len(jobs))
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			results <- self.runCheck(j.unit, j.check)
+		}(j)
 	}
+	wg.Wait()
+	close(results)
 
-	if len(newStatuses) > 0 {
-		self.Notify(newStatuses)
+	statuses := make([]Status, 0, len(jobs))
+	for status := range results {
+		log.Printf("Check %s", status)
+		statuses = append(statuses, status)
 	}
 
-	return newStatuses
+	self.recordStatuses(statuses)
+
+	return statuses
+}
+
+// runCheck runs a single check bounded by the unit's Timeout and the
+// Checker's global concurrency limit. The Timeout is enforced as a
+// context.Context deadline passed into Check.Get, so a check that respects
+// ctx (CheckHttp, CheckTcp, CheckJournalErrors' journalctl subprocess) is
+// actually cancelled/killed on timeout rather than merely abandoned; a
+// check that exceeds its timeout yields a synthetic CRIT Status either way.
+func (self *Checker) runCheck(unit Unit, check Check) Status {
+	self.sem <- struct{}{}
+	defer func() { <-self.sem }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), unit.Timeout)
+	defer cancel()
+
+	result := make(chan Status, 1)
+	go func() { result <- check.Get(ctx, unit.Name) }()
+
+	select {
+	case status := <-result:
+		return status
+	case <-ctx.Done():
+		return Status{
+			Unit: unit.Name,
+			Host: hostname,
+			Id:   "check.timeout",
+			Code: CRIT,
+			Desc: fmt.Sprintf("check exceeded timeout %s", unit.Timeout),
+		}
+	}
+}
+
+func (self *Checker) recordStatuses(statuses []Status) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.lastStatusByUnit == nil {
+		self.lastStatusByUnit = map[string]Status{}
+	}
+	for _, status := range statuses {
+		self.lastStatusByUnit[status.Unit] = status
+	}
+	self.lastRun = time.Now()
+}
+
+// LastResult returns the last known []Status for every unit and the time
+// of the most recent check cycle, for use by the control API's /healthz
+// and /checks endpoints.
+func (self *Checker) LastResult() ([]Status, time.Time) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(self.lastStatusByUnit))
+	for _, status := range self.lastStatusByUnit {
+		statuses = append(statuses, status)
+	}
+
+	return statuses, self.lastRun
+}
+
+// MaxInterval returns the longest Interval among all configured units,
+// falling back to Interval if there are none. /healthz uses this (rather
+// than the fixed global default) so a unit configured with a longer
+// per-unit Interval doesn't make the probe flap stale between its runs.
+func (self *Checker) MaxInterval() time.Duration {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var max time.Duration
+	for _, unit := range self.Units {
+		if unit.Interval > max {
+			max = unit.Interval
+		}
+	}
+
+	if max == 0 {
+		return self.Interval
+	}
+
+	return max
 }
 
 func (self *Checker) Stop() {
 	close(self.done)
 }
 
+// Watch schedules each unit independently on its own Interval (with
+// optional Jitter so a fleet of hosts doesn't all report in lockstep),
+// re-reading Units on every tick so a Reload takes effect immediately.
 func (self *Checker) Watch() {
 	self.Run()
 
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-time.After(30 * time.Second):
-			self.Run()
+		case <-ticker.C:
+			self.runDue()
 		case <-self.done:
 			log.Printf("Shutdown complete")
 			return
@@ -231,33 +457,73 @@ func (self *Checker) Watch() {
 	}
 }
 
+func (self *Checker) runDue() {
+	now := time.Now()
+
+	self.mu.Lock()
+	var due []Unit
+	for _, unit := range self.Units {
+		next, scheduled := self.nextRun[unit.Name]
+		if scheduled && next.After(now) {
+			continue
+		}
+		due = append(due, unit)
+	}
+	self.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	statuses := self.runUnits(due)
+	self.scheduleNext(due)
+
+	if toAlert := self.filterAlerts(statuses); len(toAlert) > 0 {
+		self.Notify(toAlert)
+	}
+}
+
+// jitter spreads d by up to ±pct (e.g. pct=0.1 for ±10%) so that a fleet
+// of hosts sharing the same interval doesn't all check in at once.
+func jitter(d time.Duration, pct float64) time.Duration {
+	if pct <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*pct*float64(d))
+}
+
+// Notify fans the given statuses (the alert-worthy results of a check
+// cycle, as chosen by filterAlerts) out to every configured Notifier
+// concurrently. Each notifier gets its own timeout, and a notifier that
+// errors or hangs never blocks the others or the next check cycle.
 func (self *Checker) Notify(statuses []Status) {
-	if apiUrl == "" {
+	if len(self.Notifiers) == 0 {
 		return
 	}
 
-	log.Printf("Sending to datadog")
+	var wg sync.WaitGroup
 
-	for _, status := range statuses {
-		ddStatus := NewDatadogStatus(status)
+	for _, notifier := range self.Notifiers {
+		wg.Add(1)
 
-		payload, err := json.Marshal(ddStatus)
-		if err != nil {
-			log.Printf("json.Marshal failed %+v", err)
-		}
+		go func(notifier Notifier) {
+			defer wg.Done()
 
-		req, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(payload))
-		req.Header.Set("Content-Type", "application/json")
+			result := make(chan error, 1)
+			go func() { result <- notifier.Notify(statuses) }()
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Datadog request failed %s - %+v", err, resp)
-		}
-		defer resp.Body.Close()
+			select {
+			case err := <-result:
+				if err != nil {
+					log.Printf("Notifier failed: %+v", err)
+				}
+			case <-time.After(notifierTimeout):
+				log.Printf("Notifier timed out after %s", notifierTimeout)
+			}
+		}(notifier)
 	}
 
-	log.Printf("Datadog requests complete")
+	wg.Wait()
 }
 
 func installSignalHandler(c *Checker) {
@@ -268,9 +534,19 @@ func installSignalHandler(c *Checker) {
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 	go func() {
-		s := <-sigc
-		log.Printf("Got signal: %s", s)
-		c.Stop()
+		for s := range sigc {
+			log.Printf("Got signal: %s", s)
+
+			if s == syscall.SIGHUP {
+				if err := c.Reload(); err != nil {
+					log.Printf("Reload failed: %+v", err)
+				}
+				continue
+			}
+
+			c.Stop()
+			return
+		}
 	}()
 }
 
@@ -285,9 +561,15 @@ func init() {
 	}
 
 	apiKey = os.Getenv("DATADOG_API_KEY")
-	if apiKey != "" {
-		apiUrl = fmt.Sprintf("https://app.datadoghq.com/api/v1/check_run?api_key=%s", apiKey)
+
+	configPath = os.Getenv("VX_CHECK_CONFIG")
+	if configPath == "" {
+		configPath = "vx-check.conf"
 	}
+
+	// apiAddr is the bind address for the control API; the API stays off
+	// unless this is set.
+	apiAddr = os.Getenv("VX_CHECK_API_ADDR")
 }
 
 func main() {
@@ -302,11 +584,72 @@ func main() {
 		panic(err)
 	}
 
+	if _, err := os.Stat(configPath); err == nil {
+		notifiers, err := LoadNotifiers(configPath)
+		if err != nil {
+			panic(err)
+		}
+		checker.Notifiers = notifiers
+
+		alertCfg, err := LoadAlertingConfig(configPath)
+		if err != nil {
+			panic(err)
+		}
+		if alertCfg.AlertThreshold > 0 {
+			checker.AlertThreshold = alertCfg.AlertThreshold
+		}
+		if alertCfg.FlapWindow > 0 {
+			checker.FlapWindow = alertCfg.FlapWindow
+		}
+		if alertCfg.FlapThreshold > 0 {
+			checker.FlapThreshold = alertCfg.FlapThreshold
+		}
+	}
+
+	// Env vars take precedence over the config file, matching
+	// VX_CHECK_API_ADDR/VX_CHECK_STATE_PATH below.
+	if v := os.Getenv("VX_CHECK_ALERT_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			checker.AlertThreshold = n
+		}
+	}
+	if v := os.Getenv("VX_CHECK_FLAP_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			checker.FlapWindow = d
+		}
+	}
+	if v := os.Getenv("VX_CHECK_FLAP_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			checker.FlapThreshold = n
+		}
+	}
+
+	if apiKey != "" {
+		datadog, err := NewDatadogNotifier(apiKey)
+		if err != nil {
+			panic(err)
+		}
+		checker.Notifiers = append(checker.Notifiers, datadog)
+	}
+
+	checker.StatePath = os.Getenv("VX_CHECK_STATE_PATH")
+	if checker.StatePath == "" {
+		checker.StatePath = "vx-check-state.json"
+	}
+	if err := checker.LoadState(); err != nil {
+		panic(err)
+	}
+
 	for _, unit := range checker.Units {
 		log.Printf("Add unit \"%s\"", unit.Name)
 	}
 
 	installSignalHandler(checker)
+	watchUnitDir("system", checker)
+
+	if apiAddr != "" {
+		serveAPI(apiAddr, checker)
+	}
 
 	checker.Watch()
 }
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/coreos/go-systemd/unit"
+)
+
+const notifierTimeout = 5 * time.Second
+
+// Notifier is anything that can ship a batch of Status results somewhere.
+// Checker.Notify fans out to every configured Notifier concurrently, so a
+// single slow or broken sink can't hold up the check loop.
+type Notifier interface {
+	Notify([]Status) error
+}
+
+// WebhookNotifier POSTs a user-templated JSON payload, once per Status, to
+// a configurable URL. Datadog is just the default template against
+// DATADOG_API_KEY, not a special case.
+type WebhookNotifier struct {
+	URL      string
+	Template *template.Template
+	Client   *http.Client
+}
+
+// templateFuncs exposes a "json" helper so webhook templates can embed
+// arbitrary Status field values (which may contain quotes, newlines,
+// etc. - e.g. CheckHttp's error messages embed the target URL in double
+// quotes) without producing malformed JSON.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
+func NewWebhookNotifier(url, tmpl string) (*WebhookNotifier, error) {
+	t, err := template.New("webhook").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook template - %s", err)
+	}
+
+	return &WebhookNotifier{
+		URL:      url,
+		Template: t,
+		Client:   &http.Client{Timeout: notifierTimeout},
+	}, nil
+}
+
+func (self *WebhookNotifier) Notify(statuses []Status) error {
+	var firstErr error
+
+	for _, status := range statuses {
+		var payload bytes.Buffer
+		if err := self.Template.Execute(&payload, status); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("template.Execute() - %s", err)
+			}
+			continue
+		}
+
+		req, err := http.NewRequest("POST", self.URL, &payload)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := self.Client.Do(req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("webhook request failed - %s", err)
+			}
+			continue
+		}
+		resp.Body.Close()
+	}
+
+	return firstErr
+}
+
+// datadogTemplate uses the "json" template func (rather than interpolating
+// fields straight into quotes) so that a Desc/Unit/Host/Id containing a
+// quote or newline - e.g. a wrapped url.Error from CheckHttp - still
+// produces valid JSON.
+const datadogTemplate = `{"check":{{json .Id}},"host_name":{{json .Host}},"status":{{.Code}},"message":{{json .Desc}},"tags":[{{json (printf "check:%s" .Unit)}}{{if .Flapping}},{{json "flapping:true"}}{{end}}]}`
+
+// NewDatadogNotifier builds the webhook notifier operators are used to -
+// it's the generic WebhookNotifier pointed at the check_run endpoint.
+func NewDatadogNotifier(apiKey string) (*WebhookNotifier, error) {
+	url := fmt.Sprintf("https://app.datadoghq.com/api/v1/check_run?api_key=%s", apiKey)
+	return NewWebhookNotifier(url, datadogTemplate)
+}
+
+// StatsDNotifier sends one gauge line per Status over UDP:
+// vx.check.status:<code>|g|#unit:<name>,host:<host>
+type StatsDNotifier struct {
+	Addr string
+	conn net.Conn
+}
+
+func NewStatsDNotifier(addr string) (*StatsDNotifier, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("net.Dial(udp, %s) - %s", addr, err)
+	}
+
+	return &StatsDNotifier{Addr: addr, conn: conn}, nil
+}
+
+func (self *StatsDNotifier) Notify(statuses []Status) error {
+	var firstErr error
+
+	for _, status := range statuses {
+		line := fmt.Sprintf("vx.check.status:%d|g|#unit:%s,host:%s\n", status.Code, status.Unit, status.Host)
+		if _, err := self.conn.Write([]byte(line)); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("statsd write failed - %s", err)
+		}
+	}
+
+	return firstErr
+}
+
+// InfluxDBNotifier writes one line-protocol point per Status to an
+// InfluxDB HTTP /write endpoint.
+type InfluxDBNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewInfluxDBNotifier(url string) *InfluxDBNotifier {
+	return &InfluxDBNotifier{URL: url, Client: &http.Client{Timeout: notifierTimeout}}
+}
+
+func (self *InfluxDBNotifier) Notify(statuses []Status) error {
+	var body bytes.Buffer
+
+	for _, status := range statuses {
+		fmt.Fprintf(&body, "vx_check,unit=%s,host=%s code=%d,message=\"%s\" %d\n",
+			status.Unit, status.Host, status.Code, status.Desc, time.Now().UnixNano())
+	}
+
+	req, err := http.NewRequest("POST", self.URL, &body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := self.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influxdb request failed - %s", err)
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// PrometheusNotifier keeps the latest Status it has been notified of per
+// unit in memory and serves it as a /metrics endpoint in the text
+// exposition format. Checker only notifies the statuses filterAlerts
+// passes, so a unit that has never alerted has no vx_check_status series.
+type PrometheusNotifier struct {
+	Addr string
+
+	mu      sync.Mutex
+	last    []Status
+	lastRun time.Time
+}
+
+func NewPrometheusNotifier(addr string) *PrometheusNotifier {
+	self := &PrometheusNotifier{Addr: addr}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", self.handleMetrics)
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("PrometheusNotifier: ListenAndServe(%s) - %s", addr, err)
+		}
+	}()
+
+	return self
+}
+
+func (self *PrometheusNotifier) Notify(statuses []Status) error {
+	self.mu.Lock()
+	for _, status := range statuses {
+		replaced := false
+		for i := range self.last {
+			if self.last[i].Unit == status.Unit {
+				self.last[i] = status
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			self.last = append(self.last, status)
+		}
+	}
+	self.lastRun = time.Now()
+	self.mu.Unlock()
+
+	return nil
+}
+
+func (self *PrometheusNotifier) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP vx_check_status Last status code reported for a unit (0=SUCC, 1=WARN, 2=CRIT)")
+	fmt.Fprintln(w, "# TYPE vx_check_status gauge")
+	for _, status := range self.last {
+		fmt.Fprintf(w, "vx_check_status{unit=\"%s\",host=\"%s\"} %d\n", status.Unit, status.Host, status.Code)
+	}
+
+	fmt.Fprintln(w, "# HELP vx_check_last_run_timestamp Unix time statuses were last notified (cycles with nothing to alert on leave it unchanged)")
+	fmt.Fprintln(w, "# TYPE vx_check_last_run_timestamp gauge")
+	fmt.Fprintf(w, "vx_check_last_run_timestamp %d\n", self.lastRun.Unix())
+}
+
+// notifierConfig is one [Notifier] section of the config file, e.g.:
+//
+//	[Notifier]
+//	Type=webhook
+//	Url=https://example.com/hook
+//	Template={"check":"{{.Id}}","status":{{.Code}}}
+type notifierConfig struct {
+	Type     string
+	Url      string
+	Template string
+}
+
+// LoadNotifiers parses vx-check.conf into a list of Notifiers. Each
+// [Notifier] section describes one sink.
+//
+// This deliberately isn't YAML or TOML: the unit-file format is already
+// this codebase's config DSL (see loadUnits' X-Check sections), the repo
+// takes no YAML/TOML dependency anywhere else, and unit.Deserialize is
+// already linked in for parsing .service files - reusing it here avoids
+// a second parser and a second dependency for what is structurally the
+// same kind of file.
+func LoadNotifiers(path string) ([]Notifier, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := unit.Deserialize(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []notifierConfig
+	var current *notifierConfig
+
+	for _, section := range sections {
+		if section.Section != "Notifier" {
+			continue
+		}
+
+		if section.Name == "Type" {
+			configs = append(configs, notifierConfig{Type: section.Value})
+			current = &configs[len(configs)-1]
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("[Notifier] %s= appears before Type=; Type must be the first key in each [Notifier] section", section.Name)
+		}
+
+		switch section.Name {
+		case "Url":
+			current.Url = section.Value
+		case "Template":
+			current.Template = section.Value
+		}
+	}
+
+	var notifiers []Notifier
+
+	for _, cfg := range configs {
+		switch cfg.Type {
+		case "webhook":
+			n, err := NewWebhookNotifier(cfg.Url, cfg.Template)
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, n)
+		case "statsd":
+			n, err := NewStatsDNotifier(cfg.Url)
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, n)
+		case "influxdb":
+			notifiers = append(notifiers, NewInfluxDBNotifier(cfg.Url))
+		case "prometheus":
+			notifiers = append(notifiers, NewPrometheusNotifier(cfg.Url))
+		default:
+			return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+		}
+	}
+
+	return notifiers, nil
+}
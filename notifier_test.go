@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTempConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "vx-check-conf-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	return file.Name()
+}
+
+func TestLoadNotifiersRejectsKeyBeforeType(t *testing.T) {
+	path := writeTempConfig(t, `[Notifier]
+Url=https://example.com/hook
+Type=webhook
+`)
+
+	if _, err := LoadNotifiers(path); err == nil {
+		t.Fatal("expected an error for a key appearing before Type=, got nil")
+	}
+}
+
+func TestLoadNotifiersWebhook(t *testing.T) {
+	path := writeTempConfig(t, `[Notifier]
+Type=webhook
+Url=https://example.com/hook
+Template={"check":"{{.Id}}"}
+`)
+
+	notifiers, err := LoadNotifiers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifiers) != 1 {
+		t.Fatalf("expected 1 notifier, got %d", len(notifiers))
+	}
+
+	webhook, ok := notifiers[0].(*WebhookNotifier)
+	if !ok {
+		t.Fatalf("expected *WebhookNotifier, got %T", notifiers[0])
+	}
+
+	if webhook.URL != "https://example.com/hook" {
+		t.Fatalf("expected URL to be parsed, got %q", webhook.URL)
+	}
+}
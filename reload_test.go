@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testServiceUnit = `[Unit]
+Description=Test unit
+
+[X-Check]
+Tcp=127.0.0.1:1 timeout=1s
+`
+
+func TestCheckerReloadPicksUpNewUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vx-check-units")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker, err := NewChecker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checker.Units) != 0 {
+		t.Fatalf("expected no units before reload, got %d", len(checker.Units))
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.service"), []byte(testServiceUnit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checker.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checker.Units) != 1 {
+		t.Fatalf("expected 1 unit after reload, got %d", len(checker.Units))
+	}
+
+	if checker.Units[0].Name != "new.service" {
+		t.Fatalf("expected new.service, got %s", checker.Units[0].Name)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchUnitDir watches path for .service files being added, removed, or
+// modified and triggers a Checker.Reload() within seconds, complementing
+// the SIGHUP reload path.
+func watchUnitDir(path string, checker *Checker) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("fsnotify.NewWatcher() - %s", err)
+		return
+	}
+
+	if err := watcher.Add(path); err != nil {
+		log.Printf("watcher.Add(%s) - %s", path, err)
+		return
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !strings.HasSuffix(event.Name, ".service") {
+					continue
+				}
+
+				log.Printf("Unit directory changed: %s", event)
+
+				if err := checker.Reload(); err != nil {
+					log.Printf("Reload failed: %+v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("fsnotify error: %s", err)
+			case <-checker.done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchUnitDirPicksUpNewUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vx-check-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker, err := NewChecker(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Stop()
+
+	watchUnitDir(dir, checker)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.service"), []byte(testServiceUnit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		checker.mu.RLock()
+		n := len(checker.Units)
+		checker.mu.RUnlock()
+
+		if n == 1 {
+			return
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("watchUnitDir did not pick up new.service within 5s (units=%d)", n)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}